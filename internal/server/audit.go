@@ -0,0 +1,124 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	auditKindIdent    = "ident"
+	auditKindPerms    = "perms"
+	auditKindAccount  = "account"
+	auditKindSnapshot = "snapshot"
+	auditKindPublish  = "publish"
+)
+
+// defaultActorHeader is the header consulted for the actor identity of
+// a request when Options.ActorHeader is unset.
+const defaultActorHeader = "X-Forwarded-User"
+
+// AuditEvent is a single recorded mutation.
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Name   string    `json:"name"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor,omitempty"`
+}
+
+// actorFromRequest extracts the actor identity from the header
+// configured via Options.ActorHeader (or defaultActorHeader).
+func (s *Server) actorFromRequest(r *http.Request) string {
+	header := s.opts.ActorHeader
+	if header == "" {
+		header = defaultActorHeader
+	}
+	return r.Header.Get(header)
+}
+
+// recordAudit appends ev to DataDir/audit/events.log and, when a NATS
+// connection is configured, also publishes it to
+// acl-proxy.audit.<kind>.<name>. Callers are expected to already hold
+// s.mu, or to run within a single-threaded FSM Apply.
+func (s *Server) recordAudit(ev AuditEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(s.opts.DataDir, "audit")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "events.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	if s.nc != nil {
+		subject := fmt.Sprintf("acl-proxy.audit.%s.%s", ev.Kind, ev.Name)
+		if err := s.nc.Publish(subject, data); err != nil {
+			s.log.Errorf("Failed to publish audit event: %s", err)
+		}
+	}
+	return nil
+}
+
+// listAuditEvents returns every recorded event matching the given
+// filters, in the order they were recorded.
+func (s *Server) listAuditEvents(since time.Time, kind, name string) ([]AuditEvent, error) {
+	path := filepath.Join(s.opts.DataDir, "audit", "events.log")
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []AuditEvent{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, err
+		}
+		if !since.IsZero() && ev.Time.Before(since) {
+			continue
+		}
+		if kind != "" && ev.Kind != kind {
+			continue
+		}
+		if name != "" && ev.Name != name {
+			continue
+		}
+		events = append(events, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
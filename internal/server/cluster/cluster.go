@@ -0,0 +1,147 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cluster replicates the proxy's configuration store across a
+// group of peers using Raft, so that a clustered deployment ends up
+// with an identical DataDir/current on every node.
+package cluster
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+// Options configures the Raft group backing a Cluster.
+type Options struct {
+	// NodeID uniquely identifies this peer within the cluster.
+	NodeID string
+
+	// BindAddr is the host:port the Raft transport listens on.
+	BindAddr string
+
+	// Peers is the initial set of Raft host:port addresses used to seed
+	// the cluster. Only consulted when Bootstrap is true.
+	Peers []string
+
+	// Dir is where the Raft log, stable store and snapshots are kept.
+	Dir string
+
+	// Bootstrap starts a brand new cluster seeded with Peers. It must
+	// only be set on the peer that forms the cluster for the first
+	// time, never on a peer re-joining an existing one.
+	Bootstrap bool
+}
+
+// Cluster wraps a Raft group used to replicate configuration mutations
+// across proxy peers, so that only the leader services writes while
+// every peer's FSM converges on the same state.
+type Cluster struct {
+	opts Options
+	raft *raft.Raft
+}
+
+// New creates and starts the Raft node backing a Cluster, using fsm as
+// the replicated state machine.
+func New(opts Options, fsm raft.FSM) (*Cluster, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(opts.NodeID)
+
+	addr, err := net.ResolveTCPAddr("tcp", opts.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(opts.BindAddr, addr, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(opts.Dir, 2, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	logStore, err := raftboltdb.NewBoltStore(filepath.Join(opts.Dir, "raft-log.db"))
+	if err != nil {
+		return nil, err
+	}
+	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(opts.Dir, "raft-stable.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := raft.NewRaft(config, fsm, logStore, stableStore, snapshots, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Bootstrap {
+		servers := []raft.Server{{ID: config.LocalID, Address: transport.LocalAddr()}}
+		for _, peer := range opts.Peers {
+			if peer == opts.BindAddr {
+				continue
+			}
+			servers = append(servers, raft.Server{
+				ID:      raft.ServerID(peer),
+				Address: raft.ServerAddress(peer),
+			})
+		}
+		f := r.BootstrapCluster(raft.Configuration{Servers: servers})
+		if err := f.Error(); err != nil && err != raft.ErrCantBootstrap {
+			return nil, err
+		}
+	}
+
+	return &Cluster{opts: opts, raft: r}, nil
+}
+
+// IsLeader reports whether this peer currently holds Raft leadership
+// and may service mutation endpoints.
+func (c *Cluster) IsLeader() bool {
+	return c.raft.State() == raft.Leader
+}
+
+// Leader returns the Raft bind address of the current leader, or an
+// empty string when none is known yet.
+func (c *Cluster) Leader() string {
+	return string(c.raft.Leader())
+}
+
+// Apply replicates cmd as a Raft log entry to a quorum of peers and
+// blocks until it has been applied to the local FSM, returning either a
+// Raft-level error (e.g. lost leadership, timeout) or whatever error
+// the FSM's Apply returned for this command (e.g. a disk I/O error
+// writing the snapshot).
+func (c *Cluster) Apply(cmd []byte, timeout time.Duration) error {
+	future := c.raft.Apply(cmd, timeout)
+	if err := future.Error(); err != nil {
+		return err
+	}
+	if err, ok := future.Response().(error); ok && err != nil {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops this peer from participating in the Raft group.
+func (c *Cluster) Shutdown() error {
+	return c.raft.Shutdown().Error()
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "github.com/nats-io/nats-rest-config-proxy/internal/server/cluster"
+
+// setupClustering starts the Raft group backing the Server when
+// Options.Clustering is set. It is a no-op otherwise, in which case
+// DataDir on this single instance remains the source of truth.
+func (s *Server) setupClustering() error {
+	copts := s.opts.Clustering
+	if copts == nil {
+		return nil
+	}
+
+	peers := make([]string, 0, len(copts.Peers))
+	for raftAddr := range copts.Peers {
+		peers = append(peers, raftAddr)
+	}
+
+	c, err := cluster.New(cluster.Options{
+		NodeID:    copts.NodeID,
+		BindAddr:  copts.BindAddr,
+		Peers:     peers,
+		Dir:       copts.RaftDir,
+		Bootstrap: copts.Bootstrap,
+	}, s)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cluster = c
+	s.mu.Unlock()
+
+	return nil
+}
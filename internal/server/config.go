@@ -0,0 +1,76 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "encoding/json"
+
+// renderedUser is the shape of a single user entry within auth.json.
+type renderedUser struct {
+	User        string           `json:"user"`
+	Password    string           `json:"password"`
+	Permissions *PermissionsJSON `json:"permissions,omitempty"`
+}
+
+// PermissionsJSON mirrors the nats-server authorization config block
+// for a single user.
+type PermissionsJSON struct {
+	Publish   *PermissionRules `json:"publish,omitempty"`
+	Subscribe *PermissionRules `json:"subscribe,omitempty"`
+}
+
+// renderedAccount groups the users that belong to a single account.
+type renderedAccount struct {
+	Users []*renderedUser `json:"users"`
+}
+
+// authConfig is the JSON document written as auth.json, referenced from
+// the operator managed main.conf via the $users/$accounts variables.
+type authConfig struct {
+	Users    []*renderedUser             `json:"users,omitempty"`
+	Accounts map[string]*renderedAccount `json:"accounts,omitempty"`
+}
+
+// renderAuthConfig builds the auth.json contents from the current set
+// of idents and perms.
+func (s *Server) renderAuthConfig() ([]byte, error) {
+	cfg := &authConfig{
+		Accounts: make(map[string]*renderedAccount),
+	}
+	for _, ident := range s.idents {
+		user := &renderedUser{
+			User:     ident.Username,
+			Password: ident.Password,
+		}
+		if perms, ok := s.perms[ident.Permissions]; ok {
+			user.Permissions = &PermissionsJSON{
+				Publish:   perms.Publish,
+				Subscribe: perms.Subscribe,
+			}
+		}
+		if ident.Account == "" {
+			cfg.Users = append(cfg.Users, user)
+			continue
+		}
+		acc, ok := cfg.Accounts[ident.Account]
+		if !ok {
+			acc = &renderedAccount{}
+			cfg.Accounts[ident.Account] = acc
+		}
+		acc.Users = append(acc.Users, user)
+	}
+	if len(cfg.Accounts) == 0 {
+		cfg.Accounts = nil
+	}
+	return json.MarshalIndent(cfg, "", "  ")
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nats-io/jwt"
+	"github.com/nats-io/nkeys"
+)
+
+// AuthModeConfig is the default Options.AuthMode, emitting a plain
+// auth.json the way the proxy always has.
+const AuthModeConfig = "config"
+
+// AuthModeJWT switches the proxy to issuing decentralized NKey/JWT
+// credentials instead of a password-based auth.json.
+const AuthModeJWT = "jwt"
+
+// setupJWT loads (or, on first run, generates and persists) the
+// operator keypair used to sign every account JWT. It is a no-op
+// unless Options.AuthMode is AuthModeJWT.
+func (s *Server) setupJWT() error {
+	if s.opts.AuthMode != AuthModeJWT {
+		return nil
+	}
+
+	seedPath := filepath.Join(s.opts.DataDir, "operator.seed")
+	seed, err := ioutil.ReadFile(seedPath)
+	if err == nil {
+		kp, err := nkeys.FromSeed(seed)
+		if err != nil {
+			return err
+		}
+		s.operatorKP = kp
+		return nil
+	}
+
+	kp, err := nkeys.CreateOperator()
+	if err != nil {
+		return err
+	}
+	seed, err = kp.Seed()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(seedPath, seed, 0600); err != nil {
+		return err
+	}
+	s.operatorKP = kp
+	return nil
+}
+
+// issueAccount generates an NKey and a JWT (signed by the operator) for
+// a new account. Called once at the leader before the mutation is
+// dispatched, so that every replica's FSM stores the same result
+// instead of generating its own, different keypair.
+func (s *Server) issueAccount(acc *Account) error {
+	kp, err := nkeys.CreateAccount()
+	if err != nil {
+		return err
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return err
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		return err
+	}
+
+	claims := jwt.NewAccountClaims(pub)
+	claims.Name = acc.Name
+
+	accJWT, err := claims.Encode(s.operatorKP)
+	if err != nil {
+		return err
+	}
+
+	acc.NKeyPub = pub
+	acc.NKeySeed = string(seed)
+	acc.JWT = accJWT
+	return nil
+}
+
+// issueUser generates an NKey and a JWT (signed by the ident's account)
+// for a new user, and renders the matching .creds file contents. acc
+// must already have been issued via issueAccount. Called once at the
+// leader, for the same determinism reason as issueAccount.
+func (s *Server) issueUser(ident *Ident, acc *Account, perms *Permissions) error {
+	accKP, err := nkeys.FromSeed([]byte(acc.NKeySeed))
+	if err != nil {
+		return err
+	}
+
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		return err
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return err
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		return err
+	}
+
+	claims := jwt.NewUserClaims(pub)
+	claims.Name = ident.Username
+	if perms != nil {
+		if perms.Publish != nil {
+			claims.Permissions.Pub.Allow = perms.Publish.Allow
+			claims.Permissions.Pub.Deny = perms.Publish.Deny
+		}
+		if perms.Subscribe != nil {
+			claims.Permissions.Sub.Allow = perms.Subscribe.Allow
+			claims.Permissions.Sub.Deny = perms.Subscribe.Deny
+		}
+	}
+
+	userJWT, err := claims.Encode(accKP)
+	if err != nil {
+		return err
+	}
+
+	creds, err := jwt.FormatUserConfig(userJWT, seed)
+	if err != nil {
+		return err
+	}
+
+	ident.NKeyPub = pub
+	ident.JWT = userJWT
+	ident.Creds = string(creds)
+	return nil
+}
+
+// writeJWTBundle renders the resolver preload (operator + every account
+// JWT) and the per-user .creds files under dir, the JWT
+// equivalent of writeSnapshot/promoteSnapshot for AuthModeConfig.
+func (s *Server) writeJWTBundle(dir string) error {
+	operatorJWT, err := s.operatorJWT()
+	if err != nil {
+		return err
+	}
+
+	var preload string
+	for pub, acc := range s.accountsByPubKey() {
+		preload += fmt.Sprintf("  %s: %q\n", pub, acc.JWT)
+	}
+	resolver := fmt.Sprintf("operator: %q\nresolver: MEMORY\nresolver_preload: {\n%s}\n", operatorJWT, preload)
+	if err := ioutil.WriteFile(filepath.Join(dir, "resolver.conf"), []byte(resolver), 0644); err != nil {
+		return err
+	}
+
+	credsDir := filepath.Join(dir, "creds")
+	if err := os.MkdirAll(credsDir, 0755); err != nil {
+		return err
+	}
+	return s.writeUserCreds(credsDir)
+}
+
+// operatorJWT returns a self-signed JWT for the operator keypair, used
+// as the "operator" entry of the resolver preload.
+func (s *Server) operatorJWT() (string, error) {
+	pub, err := s.operatorKP.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.NewOperatorClaims(pub)
+	return claims.Encode(s.operatorKP)
+}
+
+// accountsByPubKey indexes the configured accounts by NKey public key,
+// as required by a resolver_preload block.
+func (s *Server) accountsByPubKey() map[string]*Account {
+	out := make(map[string]*Account, len(s.accounts))
+	for _, acc := range s.accounts {
+		out[acc.NKeyPub] = acc
+	}
+	return out
+}
+
+// writeUserCreds writes one .creds file per configured ident.
+func (s *Server) writeUserCreds(dir string) error {
+	for name, ident := range s.idents {
+		if ident.Creds == "" {
+			continue
+		}
+		path := filepath.Join(dir, name+".creds")
+		if err := ioutil.WriteFile(path, []byte(ident.Creds), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// SnapshotDiff is a structured comparison between two snapshots.
+type SnapshotDiff struct {
+	AddedUsers   []string `json:"added_users,omitempty"`
+	RemovedUsers []string `json:"removed_users,omitempty"`
+	ChangedUsers []string `json:"changed_users,omitempty"`
+
+	AddedPerms   []string `json:"added_perms,omitempty"`
+	RemovedPerms []string `json:"removed_perms,omitempty"`
+	ChangedPerms []string `json:"changed_perms,omitempty"`
+
+	AddedAccounts   []string `json:"added_accounts,omitempty"`
+	RemovedAccounts []string `json:"removed_accounts,omitempty"`
+	ChangedAccounts []string `json:"changed_accounts,omitempty"`
+}
+
+// loadSnapshotConfig reads a previously taken snapshot's auth.json.
+// Callers are expected to already hold s.mu.
+func (s *Server) loadSnapshotConfig(name string) (*authConfig, error) {
+	if s.opts.AuthMode == AuthModeJWT {
+		return nil, fmt.Errorf("diff is not supported for AuthModeJWT snapshots")
+	}
+
+	path := filepath.Join(s.opts.DataDir, "snapshots", name, "auth.json")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg authConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// loadSnapshotPerms reads a previously taken snapshot's named
+// permission sets. Snapshots taken before perms.json existed are
+// treated as having none. Callers are expected to already hold s.mu.
+func (s *Server) loadSnapshotPerms(name string) (map[string]*Permissions, error) {
+	path := filepath.Join(s.opts.DataDir, "snapshots", name, "perms.json")
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]*Permissions{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var perms map[string]*Permissions
+	if err := json.Unmarshal(data, &perms); err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+// diffSnapshots compares the named snapshot against another, reporting
+// which users, named permission sets and accounts were added, removed
+// or changed in name relative to against. Callers are expected to
+// already hold s.mu.
+func (s *Server) diffSnapshots(name, against string) (*SnapshotDiff, error) {
+	a, err := s.loadSnapshotConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.loadSnapshotConfig(against)
+	if err != nil {
+		return nil, err
+	}
+	aPerms, err := s.loadSnapshotPerms(name)
+	if err != nil {
+		return nil, err
+	}
+	bPerms, err := s.loadSnapshotPerms(against)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &SnapshotDiff{}
+
+	aUsers, aAccounts := usersAndAccounts(a)
+	bUsers, bAccounts := usersAndAccounts(b)
+
+	for user := range aUsers {
+		if _, ok := bUsers[user]; !ok {
+			diff.AddedUsers = append(diff.AddedUsers, user)
+		}
+	}
+	for user, bu := range bUsers {
+		au, ok := aUsers[user]
+		if !ok {
+			diff.RemovedUsers = append(diff.RemovedUsers, user)
+			continue
+		}
+		if !sameJSON(au, bu) {
+			diff.ChangedUsers = append(diff.ChangedUsers, user)
+		}
+	}
+
+	for perm := range aPerms {
+		if _, ok := bPerms[perm]; !ok {
+			diff.AddedPerms = append(diff.AddedPerms, perm)
+		}
+	}
+	for perm, bp := range bPerms {
+		ap, ok := aPerms[perm]
+		if !ok {
+			diff.RemovedPerms = append(diff.RemovedPerms, perm)
+			continue
+		}
+		if !sameJSON(ap, bp) {
+			diff.ChangedPerms = append(diff.ChangedPerms, perm)
+		}
+	}
+
+	for acc := range aAccounts {
+		if _, ok := bAccounts[acc]; !ok {
+			diff.AddedAccounts = append(diff.AddedAccounts, acc)
+		}
+	}
+	for acc, bAcc := range bAccounts {
+		aAcc, ok := aAccounts[acc]
+		if !ok {
+			diff.RemovedAccounts = append(diff.RemovedAccounts, acc)
+			continue
+		}
+		if !sameJSON(aAcc, bAcc) {
+			diff.ChangedAccounts = append(diff.ChangedAccounts, acc)
+		}
+	}
+
+	return diff, nil
+}
+
+// usersAndAccounts indexes a rendered config's users (across both the
+// global account and every named account) by username, and its named
+// accounts by name.
+func usersAndAccounts(cfg *authConfig) (map[string]*renderedUser, map[string]*renderedAccount) {
+	users := make(map[string]*renderedUser)
+	for _, u := range cfg.Users {
+		users[u.User] = u
+	}
+	for _, acc := range cfg.Accounts {
+		for _, u := range acc.Users {
+			users[u.User] = u
+		}
+	}
+	return users, cfg.Accounts
+}
+
+// sameJSON reports whether a and b marshal to the same JSON document.
+func sameJSON(a, b interface{}) bool {
+	ad, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bd, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(ad) == string(bd)
+}
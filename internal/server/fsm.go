@@ -0,0 +1,194 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// command is a single mutation applied to the Server's state, either
+// directly or (when Options.Clustering is set) as a replicated Raft
+// log entry.
+type command struct {
+	Op       string       `json:"op"`
+	Name     string       `json:"name,omitempty"`
+	Ident    *Ident       `json:"ident,omitempty"`
+	Perms    *Permissions `json:"perms,omitempty"`
+	Account  *Account     `json:"account,omitempty"`
+	Snapshot string       `json:"snapshot,omitempty"`
+	Actor    string       `json:"actor,omitempty"`
+}
+
+const (
+	opPutIdent      = "put_ident"
+	opDeleteIdent   = "delete_ident"
+	opPutPerms      = "put_perms"
+	opDeletePerms   = "delete_perms"
+	opPutAccount    = "put_account"
+	opDeleteAccount = "delete_account"
+	opSnapshot      = "snapshot"
+	opPublish       = "publish"
+)
+
+// raftApplyTimeout bounds how long a leader waits for a command to be
+// replicated to a quorum of peers before giving up.
+const raftApplyTimeout = 5 * time.Second
+
+// dispatch applies cmd to the Server's state. When part of a Raft
+// cluster, it goes through Cluster.Apply so that every peer's FSM
+// (i.e. this same Server, via Apply below) ends up with the same
+// state; otherwise it is applied locally right away.
+func (s *Server) dispatch(cmd command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if s.cluster != nil {
+		return s.cluster.Apply(data, raftApplyTimeout)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applyCommand(data)
+}
+
+// applyCommand mutates the Server's idents/perms maps (and, for
+// snapshot/publish, the on-disk config) according to cmd. Callers must
+// already hold s.mu.
+func (s *Server) applyCommand(data []byte) error {
+	var cmd command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return err
+	}
+
+	switch cmd.Op {
+	case opPutIdent:
+		s.idents[cmd.Name] = cmd.Ident
+		s.audit(auditKindIdent, cmd.Name, "put", cmd.Actor)
+	case opDeleteIdent:
+		delete(s.idents, cmd.Name)
+		s.audit(auditKindIdent, cmd.Name, "delete", cmd.Actor)
+	case opPutPerms:
+		s.perms[cmd.Name] = cmd.Perms
+		s.audit(auditKindPerms, cmd.Name, "put", cmd.Actor)
+	case opDeletePerms:
+		delete(s.perms, cmd.Name)
+		s.audit(auditKindPerms, cmd.Name, "delete", cmd.Actor)
+	case opPutAccount:
+		s.accounts[cmd.Name] = cmd.Account
+		s.audit(auditKindAccount, cmd.Name, "put", cmd.Actor)
+	case opDeleteAccount:
+		delete(s.accounts, cmd.Name)
+		s.audit(auditKindAccount, cmd.Name, "delete", cmd.Actor)
+	case opSnapshot:
+		if err := s.writeSnapshot(cmd.Snapshot); err != nil {
+			return err
+		}
+		s.audit(auditKindSnapshot, cmd.Snapshot, "create", cmd.Actor)
+	case opPublish:
+		if err := s.promoteSnapshot(cmd.Snapshot); err != nil {
+			return err
+		}
+		s.audit(auditKindPublish, cmd.Snapshot, "publish", cmd.Actor)
+	}
+	return nil
+}
+
+// audit records ev via recordAudit, logging rather than failing the
+// mutation that triggered it when the audit log itself can't be
+// written.
+func (s *Server) audit(kind, name, action, actor string) {
+	ev := AuditEvent{Time: time.Now(), Kind: kind, Name: name, Action: action, Actor: actor}
+	if err := s.recordAudit(ev); err != nil {
+		s.log.Errorf("Failed to record audit event: %s", err)
+	}
+}
+
+// Apply implements raft.FSM. It is only invoked when Options.Clustering
+// is set, once a command has been replicated to a quorum of peers.
+func (s *Server) Apply(log *raft.Log) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.applyCommand(log.Data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// fsmSnapshot is the point-in-time copy of the FSM state that Raft
+// persists to truncate its log.
+type fsmSnapshot struct {
+	Idents   map[string]*Ident       `json:"idents"`
+	Perms    map[string]*Permissions `json:"perms"`
+	Accounts map[string]*Account     `json:"accounts"`
+}
+
+// Snapshot implements raft.FSM.
+func (s *Server) Snapshot() (raft.FSMSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idents := make(map[string]*Ident, len(s.idents))
+	for k, v := range s.idents {
+		idents[k] = v
+	}
+	perms := make(map[string]*Permissions, len(s.perms))
+	for k, v := range s.perms {
+		perms[k] = v
+	}
+	accounts := make(map[string]*Account, len(s.accounts))
+	for k, v := range s.accounts {
+		accounts[k] = v
+	}
+	return &fsmSnapshot{Idents: idents, Perms: perms, Accounts: accounts}, nil
+}
+
+// Persist implements raft.FSMSnapshot.
+func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	if _, err := sink.Write(data); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// Release implements raft.FSMSnapshot.
+func (f *fsmSnapshot) Release() {}
+
+// Restore implements raft.FSM, replacing the in-memory state with the
+// contents of a previously persisted snapshot.
+func (s *Server) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	var snap fsmSnapshot
+	if err := json.NewDecoder(rc).Decode(&snap); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idents = snap.Idents
+	s.perms = snap.Perms
+	s.accounts = snap.Accounts
+	return nil
+}
@@ -0,0 +1,420 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// setupRoutes wires up the HTTP API exposed by the Server.
+func (s *Server) setupRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/v1/auth/idents/", s.handleIdent)
+	mux.HandleFunc("/v1/auth/perms/", s.handlePerms)
+	mux.HandleFunc("/v1/auth/accounts/", s.handleAccount)
+	mux.HandleFunc("/v1/auth/snapshot", s.handleSnapshot)
+	mux.HandleFunc("/v1/auth/publish", s.handlePublish)
+	mux.HandleFunc("/v1/auth/validate", s.handleValidate)
+	mux.HandleFunc("/v1/auth/snapshots/", s.handleSnapshotDiff)
+	mux.HandleFunc("/v1/audit", s.handleAudit)
+	return mux
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// redirectIfNotLeader returns true (after writing a response) when the
+// Server is part of a Raft cluster but isn't currently the leader, so
+// that mutation endpoints are only ever serviced by the leader.
+func (s *Server) redirectIfNotLeader(w http.ResponseWriter, r *http.Request) bool {
+	if s.cluster == nil || s.cluster.IsLeader() {
+		return false
+	}
+
+	leaderHTTPAddr := s.opts.Clustering.Peers[s.cluster.Leader()]
+	if leaderHTTPAddr == "" {
+		http.Error(w, "no raft leader elected", http.StatusServiceUnavailable)
+		return true
+	}
+	http.Redirect(w, r, fmt.Sprintf("http://%s%s", leaderHTTPAddr, r.URL.RequestURI()), http.StatusTemporaryRedirect)
+	return true
+}
+
+func (s *Server) handleIdent(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/auth/idents/")
+	if name == "" {
+		http.Error(w, "missing ident name", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if s.redirectIfNotLeader(w, r) {
+			return
+		}
+		var ident Ident
+		if err := json.NewDecoder(r.Body).Decode(&ident); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ident.Username == "" {
+			ident.Username = name
+		}
+		if s.opts.AuthMode == AuthModeJWT {
+			if err := s.issueIdentCredentials(&ident); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := s.dispatch(command{Op: opPutIdent, Name: name, Ident: &ident, Actor: s.actorFromRequest(r)}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if s.redirectIfNotLeader(w, r) {
+			return
+		}
+		if err := s.dispatch(command{Op: opDeleteIdent, Name: name, Actor: s.actorFromRequest(r)}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handlePerms(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/auth/perms/")
+	if name == "" {
+		http.Error(w, "missing perms name", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if s.redirectIfNotLeader(w, r) {
+			return
+		}
+		var perms Permissions
+		if err := json.NewDecoder(r.Body).Decode(&perms); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.dispatch(command{Op: opPutPerms, Name: name, Perms: &perms, Actor: s.actorFromRequest(r)}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if s.redirectIfNotLeader(w, r) {
+			return
+		}
+		if err := s.dispatch(command{Op: opDeletePerms, Name: name, Actor: s.actorFromRequest(r)}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAccount manages accounts. In AuthModeJWT, PUT also generates
+// the account's NKey and operator-signed JWT.
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/auth/accounts/")
+	if name == "" {
+		http.Error(w, "missing account name", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if s.redirectIfNotLeader(w, r) {
+			return
+		}
+		acc := &Account{Name: name}
+		if s.opts.AuthMode == AuthModeJWT {
+			if err := s.issueAccount(acc); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := s.dispatch(command{Op: opPutAccount, Name: name, Account: acc, Actor: s.actorFromRequest(r)}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if s.redirectIfNotLeader(w, r) {
+			return
+		}
+		if err := s.dispatch(command{Op: opDeleteAccount, Name: name, Actor: s.actorFromRequest(r)}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// issueIdentCredentials generates a user NKey/JWT for ident, signed by
+// the NKey of the account it is bound to. The account must already
+// have been created via handleAccount.
+func (s *Server) issueIdentCredentials(ident *Ident) error {
+	s.mu.Lock()
+	acc, ok := s.accounts[ident.Account]
+	perms := s.perms[ident.Permissions]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown account %q", ident.Account)
+	}
+	return s.issueUser(ident, acc, perms)
+}
+
+// handleSnapshot renders the current idents/perms and stores them under
+// DataDir/snapshots/<name>, as described on writeSnapshot.
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.redirectIfNotLeader(w, r) {
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "missing snapshot name", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.dispatch(command{Op: opSnapshot, Snapshot: name, Actor: s.actorFromRequest(r)}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeSnapshot renders the current idents/perms and stores them under
+// DataDir/snapshots/<name>, either as auth.json (AuthModeConfig) or as
+// a resolver preload plus per-user .creds files (AuthModeJWT). For
+// AuthModeConfig it also stores the named permission sets as
+// perms.json, so diffSnapshots can compare them directly rather than
+// only as seen through the users that reference them. Callers are
+// expected to already hold s.mu, or to run within a single-threaded
+// FSM Apply.
+func (s *Server) writeSnapshot(name string) error {
+	dir := filepath.Join(s.opts.DataDir, "snapshots", name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if s.opts.AuthMode == AuthModeJWT {
+		return s.writeJWTBundle(dir)
+	}
+
+	data, err := s.renderAuthConfig()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "auth.json"), data, 0644); err != nil {
+		return err
+	}
+
+	permsData, err := json.Marshal(s.perms)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "perms.json"), permsData, 0644)
+}
+
+// handlePublish promotes a named snapshot to be the current one served
+// out of DataDir/current, and signals the nats-server named by
+// Options.NATSServerPIDFile, if any, to reload.
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.redirectIfNotLeader(w, r) {
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "missing snapshot name", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.dispatch(command{Op: opPublish, Snapshot: name, Actor: s.actorFromRequest(r)}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleValidate boots an embedded nats-server against the named
+// snapshot (?name=) to report whether it would actually start, or
+// against the currently staged idents/perms/accounts when name is
+// omitted or doesn't refer to an existing snapshot.
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+
+	s.mu.Lock()
+	report, err := s.validateSnapshot(name)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.OK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleAudit returns the recorded mutation history, optionally
+// filtered by a minimum timestamp, kind and/or name.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	events, err := s.listAuditEvents(since, r.URL.Query().Get("kind"), r.URL.Query().Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// handleSnapshotDiff serves GET /v1/auth/snapshots/{name}/diff?against=,
+// computing a structured diff between two previously taken snapshots.
+func (s *Server) handleSnapshotDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/auth/snapshots/")
+	if !strings.HasSuffix(path, "/diff") {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimSuffix(path, "/diff")
+	against := r.URL.Query().Get("against")
+	if name == "" || against == "" {
+		http.Error(w, "missing snapshot name or against", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	diff, err := s.diffSnapshots(name, against)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// promoteSnapshot makes the named, already written snapshot the current
+// one served out of DataDir/current, and signals the nats-server named
+// by Options.NATSServerPIDFile, if any, to reload. A failed signal is
+// only logged. Callers are expected to already hold s.mu, or to run
+// within a single-threaded FSM Apply.
+func (s *Server) promoteSnapshot(name string) error {
+	if s.opts.StrictValidate {
+		report, err := s.validateSnapshot(name)
+		if err != nil {
+			return err
+		}
+		if !report.OK {
+			return fmt.Errorf("refusing to publish invalid config: %s", report.Error)
+		}
+	}
+
+	// Only capture a snapshot if one hasn't been taken yet under this
+	// name; an already-taken snapshot must be promoted as-is, otherwise
+	// any ident/perm change made between "snapshot" and "publish" would
+	// silently overwrite what POST /v1/auth/snapshot captured, which is
+	// also what the diff endpoint reads back.
+	if _, err := os.Stat(filepath.Join(s.opts.DataDir, "snapshots", name)); os.IsNotExist(err) {
+		if err := s.writeSnapshot(name); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	current := filepath.Join(s.opts.DataDir, "current")
+	if err := os.MkdirAll(current, 0755); err != nil {
+		return err
+	}
+
+	if s.opts.AuthMode == AuthModeJWT {
+		if err := s.writeJWTBundle(current); err != nil {
+			return err
+		}
+	} else {
+		src := filepath.Join(s.opts.DataDir, "snapshots", name, "auth.json")
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(current, "auth.json"), data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := s.signalReload(); err != nil {
+		s.log.Errorf("Failed to signal config reload: %s", err)
+	}
+	return nil
+}
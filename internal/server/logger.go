@@ -0,0 +1,65 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "log"
+
+// Logger is the interface used by the Server to emit log output.
+type Logger interface {
+	Infof(format string, v ...interface{})
+	Debugf(format string, v ...interface{})
+	Tracef(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// defaultLogger is the Logger used by the Server, writing to the
+// standard library logger. NoLog sets quiet, which silences it.
+type defaultLogger struct {
+	debug bool
+	trace bool
+	quiet bool
+}
+
+// NewDefaultLogger returns a Logger backed by the standard library logger.
+func NewDefaultLogger() *defaultLogger {
+	return &defaultLogger{}
+}
+
+func (l *defaultLogger) Infof(format string, v ...interface{}) {
+	if l.quiet {
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func (l *defaultLogger) Debugf(format string, v ...interface{}) {
+	if l.quiet || !l.debug {
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func (l *defaultLogger) Tracef(format string, v ...interface{}) {
+	if l.quiet || !l.trace {
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func (l *defaultLogger) Errorf(format string, v ...interface{}) {
+	if l.quiet {
+		return
+	}
+	log.Printf(format, v...)
+}
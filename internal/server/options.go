@@ -0,0 +1,96 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+// Options is the set of options that can be used to configure a Server.
+type Options struct {
+	// Host is the network interface where the HTTP API will listen on.
+	Host string
+
+	// Port is the port where the HTTP API will listen on.
+	Port int
+
+	// DataDir is the directory where the idents, perms, accounts and
+	// published snapshots are stored.
+	DataDir string
+
+	// NoSignals disables handling of SIGINT/SIGTERM, used in tests.
+	NoSignals bool
+
+	// NoLog disables the logger output, used in tests.
+	NoLog bool
+
+	// Debug enables debug logging.
+	Debug bool
+
+	// Trace enables trace logging.
+	Trace bool
+
+	// NATSURL is the URL of a nats-server (or cluster) that the Server
+	// connects to in order to stream audit events. When empty, no
+	// connection is made and auditing only writes to DataDir/audit.
+	NATSURL string
+
+	// NATSServerPIDFile is the path to the PID file of the nats-server
+	// that should be asked to reload its configuration after a publish,
+	// written with nats-server's own "-P" flag. When a publish succeeds,
+	// the Server sends that process SIGHUP, the same signal "nats-server
+	// -sl reload=<pid>" uses, so it re-reads the authorization config
+	// without a restart. Left empty, publishing only writes the snapshot
+	// to disk and operators are expected to reload manually.
+	NATSServerPIDFile string
+
+	// AuthMode selects how published credentials are rendered: either
+	// AuthModeConfig (default), the classic username/password auth.json,
+	// or AuthModeJWT, which issues decentralized NKey/JWT credentials
+	// instead.
+	AuthMode string
+
+	// ActorHeader is the HTTP header consulted to attribute an actor
+	// identity to every audited mutation. Defaults to
+	// "X-Forwarded-User" when unset.
+	ActorHeader string
+
+	// StrictValidate makes publish refuse to promote a snapshot that
+	// fails the same check as POST /v1/auth/validate, so operators
+	// never ship a config that would crash-loop their nats-servers.
+	StrictValidate bool
+
+	// Clustering, when set, replicates every mutation across a group of
+	// proxy peers via Raft instead of treating DataDir as the sole
+	// source of truth. Only the Raft leader services mutation requests.
+	Clustering *ClusteringOptions
+}
+
+// ClusteringOptions configures a replicated group of proxy peers that
+// share a single source of truth via Raft.
+type ClusteringOptions struct {
+	// NodeID uniquely identifies this peer within the cluster.
+	NodeID string
+
+	// BindAddr is the host:port the Raft transport listens on.
+	BindAddr string
+
+	// RaftDir is where the Raft log, stable store and snapshots live.
+	RaftDir string
+
+	// Bootstrap starts a brand new cluster from this peer, seeded with
+	// the addresses in Peers. Only the peer that forms the cluster for
+	// the first time should set this.
+	Bootstrap bool
+
+	// Peers maps every peer's Raft BindAddr to its HTTP API address, so
+	// that followers can redirect mutation requests to the leader.
+	Peers map[string]string
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// connectNATS establishes (with reconnect logic) the connection used to
+// stream audit events, when Options.NATSURL is set. It is a no-op
+// otherwise, so that publishing keeps working the same way it always
+// has for operators relying on a manual SIGHUP.
+func (s *Server) connectNATS() error {
+	if s.opts.NATSURL == "" {
+		return nil
+	}
+
+	nc, err := nats.Connect(s.opts.NATSURL,
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			s.log.Errorf("Disconnected from NATS: %s", err)
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			s.log.Infof("Reconnected to NATS")
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.nc = nc
+	s.mu.Unlock()
+
+	return nil
+}
+
+// signalReload asks the nats-server named in Options.NATSServerPIDFile
+// to reload its configuration after a new snapshot has been promoted,
+// by sending it SIGHUP: nats-server installs its own SIGHUP handler
+// that calls its Reload(), the same mechanism its "-sl reload=<pid>"
+// flag uses. There is no NATS subject a stock nats-server reacts to for
+// this, so unlike audit streaming it can't be done over s.nc. It is a
+// no-op when no PID file has been configured.
+func (s *Server) signalReload() error {
+	path := s.opts.NATSServerPIDFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Signal(syscall.SIGHUP)
+}
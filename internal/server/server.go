@@ -15,10 +15,17 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+
+	"github.com/nats-io/nats-rest-config-proxy/internal/server/cluster"
 )
 
 const (
@@ -38,6 +45,33 @@ type Server struct {
 
 	// log is the Logger from the server.
 	log Logger
+
+	// httpSrv is the HTTP API server.
+	httpSrv *http.Server
+
+	// nc is the connection used to stream audit events, when
+	// Options.NATSURL is set.
+	nc *nats.Conn
+
+	// idents is the set of configured users, keyed by name.
+	idents map[string]*Ident
+
+	// perms is the set of configured named permissions, keyed by name.
+	perms map[string]*Permissions
+
+	// accounts is the set of accounts created via /v1/auth/accounts,
+	// keyed by name. When Options.AuthMode is AuthModeJWT they also
+	// carry the NKey and JWT used to sign their users' credentials.
+	accounts map[string]*Account
+
+	// operatorKP signs every account JWT when Options.AuthMode is
+	// AuthModeJWT.
+	operatorKP nkeys.KeyPair
+
+	// cluster replicates every mutation across peers via Raft when
+	// Options.Clustering is set; nil otherwise, in which case DataDir
+	// alone is the source of truth.
+	cluster *cluster.Cluster
 }
 
 // NewServer returns a configured server.
@@ -46,7 +80,10 @@ func NewServer(opts *Options) *Server {
 		opts = &Options{}
 	}
 	s := &Server{
-		opts: opts,
+		opts:     opts,
+		idents:   make(map[string]*Ident),
+		perms:    make(map[string]*Permissions),
+		accounts: make(map[string]*Account),
 	}
 	s.configureLogger(opts)
 
@@ -57,6 +94,7 @@ func (s *Server) configureLogger(opts *Options) {
 	logger := NewDefaultLogger()
 	logger.debug = opts.Debug
 	logger.trace = opts.Trace
+	logger.quiet = opts.NoLog
 	s.log = logger
 }
 
@@ -67,13 +105,45 @@ func (s *Server) Run(ctx context.Context) error {
 		go s.SetupSignalHandler(ctx)
 	}
 
+	if err := os.MkdirAll(s.opts.DataDir, 0755); err != nil {
+		return err
+	}
+
+	if err := s.connectNATS(); err != nil {
+		return err
+	}
+
+	if err := s.setupJWT(); err != nil {
+		return err
+	}
+
+	if err := s.setupClustering(); err != nil {
+		return err
+	}
+
 	// Set up cancellation context for the main loop.
 	ctx, cancelFn := context.WithCancel(ctx)
 
+	s.mu.Lock()
+	s.httpSrv = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", s.opts.Host, s.opts.Port),
+		Handler: s.setupRoutes(),
+	}
+	httpSrv := s.httpSrv
+	s.mu.Unlock()
+
+	go func() {
+		if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.log.Errorf("Error running HTTP API: %s", err)
+		}
+	}()
+
+	s.mu.Lock()
 	s.quit = func() {
 		// Signal cancellation of the main context.
 		cancelFn()
 	}
+	s.mu.Unlock()
 
 	select {
 	case <-ctx.Done():
@@ -82,8 +152,32 @@ func (s *Server) Run(ctx context.Context) error {
 }
 
 // Shutdown stops the controller.
-func (s *Server) Shutdown() {
-	s.quit()
+func (s *Server) Shutdown(ctx context.Context) {
+	s.mu.Lock()
+	quit := s.quit
+	httpSrv := s.httpSrv
+	nc := s.nc
+	cl := s.cluster
+	s.mu.Unlock()
+
+	// Run may not have gotten far enough to set quit, e.g. if
+	// connectNATS/setupJWT/setupClustering returned an error first.
+	if quit != nil {
+		quit()
+	}
+
+	if httpSrv != nil {
+		httpSrv.Shutdown(ctx)
+	}
+	if cl != nil {
+		if err := cl.Shutdown(); err != nil {
+			s.log.Errorf("Error shutting down cluster: %s", err)
+		}
+	}
+	if nc != nil {
+		nc.Close()
+	}
+
 	s.log.Infof("Bye...")
 	return
 }
@@ -110,7 +204,7 @@ func (s *Server) SetupSignalHandler(ctx context.Context) {
 			return
 		case syscall.SIGTERM:
 			// Gracefully shutdown the server.
-			s.Shutdown()
+			s.Shutdown(ctx)
 			return
 		}
 	}
@@ -0,0 +1,69 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+// Ident is a single user, optionally bound to a named set of
+// Permissions and to an Account. In AuthModeConfig it authenticates
+// with Username/Password; in AuthModeJWT it authenticates with the
+// decentralized NKey/JWT credentials generated on creation instead.
+type Ident struct {
+	Username    string `json:"username"`
+	Password    string `json:"password,omitempty"`
+	Permissions string `json:"permissions,omitempty"`
+	Account     string `json:"account,omitempty"`
+
+	// NKeyPub is this user's NKey public key, set when AuthModeJWT.
+	NKeyPub string `json:"nkey_pub,omitempty"`
+
+	// JWT is this user's signed JWT, set when AuthModeJWT.
+	JWT string `json:"jwt,omitempty"`
+
+	// Creds holds the rendered .creds file contents (JWT + seed) for
+	// this user, set when AuthModeJWT. It is tagged for JSON so it
+	// survives the command round-trip in dispatch/applyCommand (and
+	// Raft replication); no handler ever encodes an Ident back to an
+	// HTTP client, so this doesn't leak over the API.
+	Creds string `json:"creds,omitempty"`
+}
+
+// PermissionRules is a list of subjects that are allowed or denied for
+// either publishing or subscribing.
+type PermissionRules struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Permissions is a named set of publish/subscribe rules that can be
+// referenced by one or more Idents.
+type Permissions struct {
+	Publish   *PermissionRules `json:"publish,omitempty"`
+	Subscribe *PermissionRules `json:"subscribe,omitempty"`
+}
+
+// Account is an isolated NATS account that one or more Idents can be
+// bound to. In AuthModeJWT it also carries the generated NKey and the
+// operator-signed JWT used to sign its users' JWTs.
+type Account struct {
+	Name string `json:"name"`
+
+	// NKeyPub is this account's NKey public key, set when AuthModeJWT.
+	NKeyPub string `json:"nkey_pub,omitempty"`
+
+	// NKeySeed is this account's NKey seed, used to sign its users'
+	// JWTs. Set when AuthModeJWT.
+	NKeySeed string `json:"nkey_seed,omitempty"`
+
+	// JWT is this account's operator-signed JWT, set when AuthModeJWT.
+	JWT string `json:"jwt,omitempty"`
+}
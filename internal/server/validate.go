@@ -0,0 +1,133 @@
+// Copyright 2018 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// validateReadyTimeout bounds how long validateSnapshot waits for the
+// embedded nats-server to come up before declaring the config invalid.
+const validateReadyTimeout = 5 * time.Second
+
+// ValidationReport is the result of validating a candidate
+// configuration against an embedded nats-server.
+type ValidationReport struct {
+	OK       bool     `json:"ok"`
+	Accounts int      `json:"accounts"`
+	Users    int      `json:"users"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// validateSnapshot boots an in-process nats-server with NoListen and a
+// random port against the candidate config to learn whether it would
+// actually start, rather than operators finding out the hard way after
+// a publish. When name refers to an already-taken snapshot, that
+// snapshot's persisted auth.json/resolver.conf is validated as-is;
+// otherwise (or when it doesn't exist) the currently staged
+// idents/perms/accounts are rendered and validated instead. Callers are
+// expected to already hold s.mu.
+func (s *Server) validateSnapshot(name string) (*ValidationReport, error) {
+	srcDir := ""
+	if name != "" {
+		snapDir := filepath.Join(s.opts.DataDir, "snapshots", name)
+		if _, err := os.Stat(snapDir); err == nil {
+			srcDir = snapDir
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "nats-rest-config-proxy-validate")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	users, accounts := len(s.idents), len(s.accounts)
+	if srcDir == "" {
+		srcDir = dir
+		if s.opts.AuthMode == AuthModeJWT {
+			if err := s.writeJWTBundle(dir); err != nil {
+				return nil, err
+			}
+		} else {
+			data, err := s.renderAuthConfig()
+			if err != nil {
+				return nil, err
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "auth.json"), data, 0644); err != nil {
+				return nil, err
+			}
+		}
+	} else if s.opts.AuthMode != AuthModeJWT {
+		cfg, err := s.loadSnapshotConfig(name)
+		if err != nil {
+			return nil, err
+		}
+		snapUsers, snapAccounts := usersAndAccounts(cfg)
+		users, accounts = len(snapUsers), len(snapAccounts)
+	}
+
+	confPath := filepath.Join(dir, "main.conf")
+	if err := ioutil.WriteFile(confPath, []byte(s.synthesizeMainConf(srcDir)), 0644); err != nil {
+		return nil, err
+	}
+
+	opts, err := natsserver.ProcessConfigFile(confPath)
+	if err != nil {
+		return &ValidationReport{Error: err.Error()}, nil
+	}
+	opts.Port = -1
+	opts.DontListen = true
+	opts.NoLog = true
+	opts.NoSigs = true
+
+	ns, err := natsserver.NewServer(opts)
+	if err != nil {
+		return &ValidationReport{Error: err.Error()}, nil
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+
+	if !ns.ReadyForConnections(validateReadyTimeout) {
+		return &ValidationReport{Error: "timed out waiting for nats-server to be ready"}, nil
+	}
+
+	report := &ValidationReport{
+		OK:       true,
+		Accounts: accounts,
+		Users:    users,
+	}
+	if users == 0 {
+		report.Warnings = append(report.Warnings, "no users configured")
+	}
+	return report, nil
+}
+
+// synthesizeMainConf renders the minimal main.conf that loads the
+// rendered auth.json/resolver.conf out of dir.
+func (s *Server) synthesizeMainConf(dir string) string {
+	if s.opts.AuthMode == AuthModeJWT {
+		return fmt.Sprintf("include %q\n", filepath.Join(dir, "resolver.conf"))
+	}
+	return fmt.Sprintf("\nauthorization {\n include %q \n}\n", filepath.Join(dir, "auth.json"))
+}